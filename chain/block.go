@@ -1,8 +1,10 @@
 package chain
 
 import (
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 /*
@@ -23,6 +25,11 @@ import (
 
 	This allows us to implement a process to remove entire blocks from `blockTracker` if they cannot be accepted anymore
 	for being below `maxHeight` (assumed different blocks cannot share the same height and IDs are unique).
+
+	That removal is `PruneBlocks`: it drops every height below a caller-supplied retain height and advances `base`
+	so the map stops growing without bound. `base` can never move past `maxHeight+1`, since pruning a height that
+	hasn't been decided yet would throw away history we still need. `NewBlockProcessorWithOptions` can run this on
+	a timer via `PruneInterval`, mirroring how an ABCI app reports a retain height to bound state growth.
 */
 
 const minAcceptedBlockCount = 3
@@ -35,16 +42,167 @@ type BlockProcessor struct {
 	// atomically stores max height
 	maxHeight uint64
 
+	// atomically stores the lowest height still tracked. Heights below base have been
+	// pruned and are never reconsidered, even if a late block arrives for them
+	base uint64
+
 	// concurrently tracks heights and blocks
 	blockTracker sync.Map
+
+	// acceptedByHeight maps height (uint64) -> the ID (string) of the block
+	// accepted at that height, so ProcessHeaders can validate parent linkage
+	acceptedByHeight sync.Map
+
+	// closed to stop any background goroutine started via NewBlockProcessorWithOptions
+	stopCh chan struct{}
+
+	// store durably records acceptances when set via NewBlockProcessorWithStore;
+	// nil otherwise, meaning acceptance isn't persisted
+	store Store
+
+	// walCh carries newly accepted (height, blockID) pairs, and prune commands,
+	// to the single writer goroutine that owns store, so the hot acceptance
+	// path only waits on the writer when walCh's buffer is full, and prunes
+	// never race appends
+	walCh   chan walEntry
+	walDone chan struct{}
+
+	walMu  sync.Mutex
+	walErr error
+
+	closeOnce sync.Once
+
+	// params holds any ConsensusParams changes scheduled via UpdateParams
+	params paramsSchedule
+}
+
+// Options configures optional background behavior for a BlockProcessor.
+type Options struct {
+	// PruneInterval, if non-zero, starts a background goroutine that periodically
+	// calls PruneBlocks(maxHeight-KeepRecent), retaining maxHeight and the
+	// KeepRecent heights below it.
+	PruneInterval time.Duration
+
+	// KeepRecent is how many accepted heights below maxHeight are retained, in
+	// addition to maxHeight itself, each time the background pruning goroutine
+	// runs. Only meaningful when PruneInterval is non-zero.
+	KeepRecent uint64
 }
 
 // NewBlockProcessor creates a new block processor with an accepted genesis block
 func NewBlockProcessor() *BlockProcessor {
-	return &BlockProcessor{
+	p := &BlockProcessor{
 		maxHeight:    0, // genesis block is accepted
 		blockTracker: sync.Map{},
 	}
+	p.acceptedByHeight.Store(uint64(0), GenesisID)
+	return p
+}
+
+// NewBlockProcessorWithOptions creates a new block processor the same way
+// NewBlockProcessor does, additionally starting a background goroutine that
+// periodically prunes history when opts.PruneInterval is non-zero.
+func NewBlockProcessorWithOptions(opts Options) *BlockProcessor {
+	p := &BlockProcessor{
+		maxHeight:    0,
+		blockTracker: sync.Map{},
+		stopCh:       make(chan struct{}),
+	}
+	p.acceptedByHeight.Store(uint64(0), GenesisID)
+
+	if opts.PruneInterval > 0 {
+		go p.runPruneLoop(opts.PruneInterval, opts.KeepRecent)
+	}
+
+	return p
+}
+
+// runPruneLoop periodically prunes history below maxHeight-keepRecent, stopping
+// when p.stopCh is closed.
+func (p *BlockProcessor) runPruneLoop(interval time.Duration, keepRecent uint64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			maxHeight := atomic.LoadUint64(&p.maxHeight)
+			if maxHeight > keepRecent {
+				p.PruneBlocks(maxHeight - keepRecent)
+			}
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// Base returns the lowest height still tracked by the processor. Heights below
+// Base have been pruned via PruneBlocks and are never accepted again.
+func (p *BlockProcessor) Base() uint64 {
+	return atomic.LoadUint64(&p.base)
+}
+
+// PruneBlocks discards tracked history below retainHeight and advances base to
+// retainHeight, so ProcessBlocks no longer considers heights below it. It returns
+// the number of heights that were removed from blockTracker. If the processor
+// was created via NewBlockProcessorWithStore, persisted records below
+// retainHeight are discarded too, via a pruneCommand routed through the WAL
+// writer goroutine so it can never run ahead of an acceptedRecord still
+// sitting in walCh's buffer.
+//
+// retainHeight may not exceed maxHeight+1: pruning cannot run ahead of acceptance,
+// since that would discard heights that haven't been decided yet.
+func (p *BlockProcessor) PruneBlocks(retainHeight uint64) (uint64, error) {
+	maxHeight := atomic.LoadUint64(&p.maxHeight)
+	if retainHeight > maxHeight+1 {
+		return 0, fmt.Errorf("chain: retain height %d is ahead of max accepted height %d", retainHeight, maxHeight)
+	}
+
+	for {
+		curBase := atomic.LoadUint64(&p.base)
+		// base is monotonic and never decreases, so a retainHeight at or below it
+		// is a no-op
+		if retainHeight <= curBase {
+			return 0, nil
+		}
+
+		if !atomic.CompareAndSwapUint64(&p.base, curBase, retainHeight) {
+			continue
+		}
+
+		var pruned uint64
+		p.blockTracker.Range(func(key, value interface{}) bool {
+			height := key.(uint64)
+			if height > 0 && height < retainHeight {
+				p.blockTracker.Delete(key)
+				pruned++
+			}
+			return true
+		})
+
+		// acceptedByHeight would otherwise grow at the same rate maxHeight does,
+		// reintroducing the unbounded growth PruneBlocks exists to prevent. The
+		// entry at retainHeight-1 is kept: it's the parent ProcessHeaders checks
+		// against for the first header at the new base.
+		boundary := retainHeight - 1
+		p.acceptedByHeight.Range(func(key, value interface{}) bool {
+			height := key.(uint64)
+			if height < boundary {
+				p.acceptedByHeight.Delete(key)
+			}
+			return true
+		})
+
+		if p.walCh != nil {
+			done := make(chan error, 1)
+			p.walCh <- walEntry{prune: &pruneCommand{retainHeight: retainHeight, done: done}}
+			if err := <-done; err != nil {
+				return pruned, fmt.Errorf("chain: pruning store below height %d: %w", retainHeight, err)
+			}
+		}
+
+		return pruned, nil
+	}
 }
 
 // ProcessBlocks consumes a sequence of block transactions ids of certain height and
@@ -60,7 +218,8 @@ func (p *BlockProcessor) ProcessBlocks(startHeight uint64, blocks []string) uint
 		// In reality in a high concurrency environment this might not have any benefit, atomic calls can be expensive
 		// and the only way to determine that would be to properly benchmark different implementations
 		currentMaxHeight := atomic.LoadUint64(&p.maxHeight)
-		if blockHeight > currentMaxHeight {
+		currentBase := atomic.LoadUint64(&p.base)
+		if blockHeight > currentMaxHeight && blockHeight >= currentBase {
 			p.processBlock(blockHeight, block)
 		}
 		blockHeight++
@@ -89,13 +248,15 @@ func (p *BlockProcessor) processBlock(height uint64, block string) {
 		atomic.AddUint64(currentCount, 1)
 	}
 
-	// A block can be accepted now so we can update maxHeight
-	if *currentCount >= minAcceptedBlockCount {
-		p.updateMaxHeight(height)
+	// A block can be accepted now so we can update maxHeight. The threshold is the
+	// one ParamsAt returns for this target height, so a scheduled params change only
+	// ever affects heights it's actually in effect for
+	if *currentCount >= uint64(p.ParamsAt(height).MinConfirmations) {
+		p.updateMaxHeight(height, block)
 	}
 }
 
-func (p *BlockProcessor) updateMaxHeight(height uint64) {
+func (p *BlockProcessor) updateMaxHeight(height uint64, block string) {
 	// Try to update maxHeight but it's possible another block was accepted for the same height in another thread
 	// and the block that got us here cannot be accepted anymore for this height
 
@@ -110,6 +271,10 @@ func (p *BlockProcessor) updateMaxHeight(height uint64) {
 		// if the height we're trying to set as maximum maxHeight was incremented by another thread, we cannot use this height anymore
 		// and need to retry. Otherwise, we're good to return with a new maxHeight set
 		if atomic.CompareAndSwapUint64(&p.maxHeight, p.maxHeight, height) {
+			p.acceptedByHeight.Store(height, block)
+			if p.walCh != nil {
+				p.walCh <- walEntry{accept: &acceptedRecord{height: height, blockID: block}}
+			}
 			return
 		}
 	}
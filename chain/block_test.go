@@ -3,6 +3,7 @@ package chain
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -216,8 +217,81 @@ func TestConcurrentBlocksAcceptedAsHeightIncreasesWhileProcessing(t *testing.T)
 	assert.EqualValues(t, expectedHeight, height)
 }
 
+// pruning tests
+
+func TestPruneBlocksRemovesHeightsBelowRetainHeight(t *testing.T) {
+	processor := NewBlockProcessor()
+	acceptAtHeight(processor, 1, "a")
+	acceptAtHeight(processor, 2, "b")
+
+	pruned, err := processor.PruneBlocks(2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, pruned)
+	assert.EqualValues(t, 2, processor.Base())
+}
+
+func TestPruneBlocksRejectsRetainHeightAheadOfMaxHeightPlusOne(t *testing.T) {
+	processor := NewBlockProcessor()
+	acceptAtHeight(processor, 1, "a")
+
+	pruned, err := processor.PruneBlocks(5)
+	assert.Error(t, err)
+	assert.EqualValues(t, 0, pruned)
+	assert.EqualValues(t, 0, processor.Base())
+}
+
+func TestPruneBlocksBaseNeverDecreases(t *testing.T) {
+	processor := NewBlockProcessor()
+	acceptAtHeight(processor, 1, "a")
+	acceptAtHeight(processor, 2, "b")
+
+	_, err := processor.PruneBlocks(2)
+	assert.NoError(t, err)
+
+	pruned, err := processor.PruneBlocks(1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, pruned)
+	assert.EqualValues(t, 2, processor.Base())
+}
+
+func TestProcessBlocksIgnoresLateArrivalsBelowBase(t *testing.T) {
+	processor := NewBlockProcessor()
+	acceptAtHeight(processor, 1, "a")
+	acceptAtHeight(processor, 2, "b")
+	processor.PruneBlocks(2)
+
+	// late duplicates for the pruned height should never resurrect it
+	height := acceptAtHeight(processor, 1, "c")
+	assert.EqualValues(t, 2, height)
+}
+
+func TestNewBlockProcessorWithOptionsPrunesInBackground(t *testing.T) {
+	processor := NewBlockProcessorWithOptions(Options{
+		PruneInterval: 10 * time.Millisecond,
+		KeepRecent:    1,
+	})
+
+	acceptAtHeight(processor, 1, "a")
+	acceptAtHeight(processor, 2, "b")
+	acceptAtHeight(processor, 3, "c")
+
+	assert.Eventually(t, func() bool {
+		return processor.Base() >= 2
+	}, time.Second, 5*time.Millisecond)
+}
+
 // Test helpers
 
+// acceptAtHeight submits block minAcceptedBlockCount times at height, which is
+// enough for it to be accepted as long as height is processor.maxHeight+1.
+func acceptAtHeight(processor *BlockProcessor, height uint64, block string) uint64 {
+	var result uint64
+	for i := 0; i < minAcceptedBlockCount; i++ {
+		result = processor.ProcessBlocks(height, []string{block})
+	}
+	return result
+}
+
 // processTestBlocks makes makes as many ProcessBlocks calls as the length of the blocksList
 // which is a list of blocks (slice of slice of blocks)
 // All calls have the same start height
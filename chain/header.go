@@ -0,0 +1,65 @@
+package chain
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+/*
+	ProcessBlocks treats blocks as bare strings and only checks that a height is exactly
+	maxHeight+1, so nothing stops an accepted block at height H from being followed by an
+	unrelated accepted block at height H+1 that doesn't actually descend from it: height alone
+	is just a popularity contest, not a chain.
+
+	ProcessHeaders fixes that by requiring a Header's ParentID to match the ID already accepted
+	at the previous height (recorded in BlockProcessor.acceptedByHeight) before its vote is even
+	counted. That makes acceptance a chain property: a header describing a fork is rejected
+	outright via ErrParentMismatch instead of silently competing for votes.
+
+	Genesis is the well-known sentinel GenesisID, so a Header at height 1 extends it by setting
+	ParentID to GenesisID.
+*/
+
+// GenesisID is the well-known ID of the genesis block, the implicit parent a
+// Header at height 1 must reference via ParentID.
+const GenesisID = "genesis"
+
+// ErrParentMismatch is returned by ProcessHeaders when a header's ParentID does
+// not match the ID accepted at the previous height, meaning the header
+// describes a fork rather than an extension of the accepted chain.
+var ErrParentMismatch = errors.New("chain: header parent does not match block accepted at previous height")
+
+// Header identifies a block by its own ID and height, plus the ID of the block
+// it extends, so acceptance can be tied to chain linkage rather than height alone.
+type Header struct {
+	Height    uint64
+	ID        string
+	ParentID  string
+	Timestamp int64
+}
+
+// ProcessHeaders consumes a sequence of headers and returns the maximum accepted
+// height. A header is only counted toward acceptance once its ParentID matches
+// the ID already accepted at Height-1; a header whose ParentID doesn't match is
+// rejected with ErrParentMismatch rather than competing for votes at its height.
+//
+// Processing stops at the first mismatch, since every header after a rejected
+// one could itself be describing a fork built on the rejected header.
+func (p *BlockProcessor) ProcessHeaders(headers []Header) (uint64, error) {
+	for _, h := range headers {
+		currentMaxHeight := atomic.LoadUint64(&p.maxHeight)
+		currentBase := atomic.LoadUint64(&p.base)
+		if h.Height <= currentMaxHeight || h.Height < currentBase {
+			continue
+		}
+
+		parent, ok := p.acceptedByHeight.Load(h.Height - 1)
+		if !ok || parent.(string) != h.ParentID {
+			return atomic.LoadUint64(&p.maxHeight), ErrParentMismatch
+		}
+
+		p.processBlock(h.Height, h.ID)
+	}
+
+	return atomic.LoadUint64(&p.maxHeight), nil
+}
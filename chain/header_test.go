@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessHeadersAcceptsHeaderExtendingGenesis(t *testing.T) {
+	processor := NewBlockProcessor()
+	header := Header{Height: 1, ID: "a", ParentID: GenesisID}
+
+	var height uint64
+	var err error
+	for i := 0; i < minAcceptedBlockCount; i++ {
+		height, err = processor.ProcessHeaders([]Header{header})
+	}
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, height)
+}
+
+func TestProcessHeadersRejectsParentMismatch(t *testing.T) {
+	processor := NewBlockProcessor()
+	header := Header{Height: 1, ID: "a", ParentID: "not-genesis"}
+
+	height, err := processor.ProcessHeaders([]Header{header})
+
+	assert.ErrorIs(t, err, ErrParentMismatch)
+	assert.EqualValues(t, 0, height)
+}
+
+func TestProcessHeadersRejectsHeightAheadOfAcceptedParent(t *testing.T) {
+	// height 2 claims a parent that hasn't been accepted at height 1 yet
+	processor := NewBlockProcessor()
+	header := Header{Height: 2, ID: "b", ParentID: "a"}
+
+	height, err := processor.ProcessHeaders([]Header{header})
+
+	assert.ErrorIs(t, err, ErrParentMismatch)
+	assert.EqualValues(t, 0, height)
+}
+
+func TestProcessHeadersChainsAcrossHeights(t *testing.T) {
+	processor := NewBlockProcessor()
+	first := Header{Height: 1, ID: "a", ParentID: GenesisID}
+	second := Header{Height: 2, ID: "b", ParentID: "a"}
+
+	for i := 0; i < minAcceptedBlockCount; i++ {
+		processor.ProcessHeaders([]Header{first})
+	}
+
+	var height uint64
+	var err error
+	for i := 0; i < minAcceptedBlockCount; i++ {
+		height, err = processor.ProcessHeaders([]Header{second})
+	}
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, height)
+}
+
+func TestPruneBlocksReclaimsAcceptedByHeightKeepingTheBoundaryEntry(t *testing.T) {
+	processor := NewBlockProcessor()
+	acceptHeader(processor, Header{Height: 1, ID: "a", ParentID: GenesisID})
+	acceptHeader(processor, Header{Height: 2, ID: "b", ParentID: "a"})
+	acceptHeader(processor, Header{Height: 3, ID: "c", ParentID: "b"})
+
+	_, err := processor.PruneBlocks(3)
+	assert.NoError(t, err)
+
+	_, ok := processor.acceptedByHeight.Load(uint64(0))
+	assert.False(t, ok, "genesis entry should have been reclaimed")
+	_, ok = processor.acceptedByHeight.Load(uint64(1))
+	assert.False(t, ok, "height 1 entry should have been reclaimed")
+
+	boundary, ok := processor.acceptedByHeight.Load(uint64(2))
+	assert.True(t, ok, "the boundary entry at retainHeight-1 must survive for ProcessHeaders' parent check")
+	assert.Equal(t, "b", boundary)
+
+	// a header extending height 3 still validates: its parent entry at height 3
+	// lies above the boundary and was never pruned
+	height, err := processor.ProcessHeaders([]Header{{Height: 4, ID: "d", ParentID: "c"}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, height)
+}
+
+func TestProcessBlocksIgnoresParentLinkageForBackwardsCompatibility(t *testing.T) {
+	// the legacy string API never had parent information, and must keep
+	// accepting blocks purely on height + vote count
+	processor := NewBlockProcessor()
+
+	height := acceptAtHeight(processor, 1, "unrelated-to-genesis")
+	assert.EqualValues(t, 1, height)
+}
+
+// acceptHeader submits header minAcceptedBlockCount times, enough for it to be
+// accepted as long as header.Height is processor.maxHeight+1 and its ParentID
+// matches what's accepted at header.Height-1.
+func acceptHeader(processor *BlockProcessor, header Header) (uint64, error) {
+	var height uint64
+	var err error
+	for i := 0; i < minAcceptedBlockCount; i++ {
+		height, err = processor.ProcessHeaders([]Header{header})
+	}
+	return height, err
+}
@@ -0,0 +1,98 @@
+package chain
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	Hard-coding minAcceptedBlockCount prevents callers from tuning safety vs. latency, and rules
+	out the kind of validator-set-change semantics real consensus engines use: a change decided
+	at height H must not retroactively apply to H itself, since blocks around H may already be
+	in flight under the old rule. So a ConsensusParams change scheduled via UpdateParams(H, ...)
+	only takes effect starting at height H+1 - never at H - and ParamsAt(height) is what every
+	acceptance decision consults to find out which rule actually governs a given height.
+*/
+
+// ConsensusParams controls how many confirmations are required for a height to
+// be accepted.
+type ConsensusParams struct {
+	// MinConfirmations is how many times a block must be reported at the same
+	// height before BlockProcessor accepts it.
+	MinConfirmations uint32
+
+	// MinDistinctReporters is how many distinct peers must report the same
+	// (height, blockID) pair before BlockPool forwards it to the BlockProcessor.
+	MinDistinctReporters uint32
+}
+
+// defaultConsensusParams is used for every height with no scheduled change in
+// effect yet.
+var defaultConsensusParams = ConsensusParams{
+	MinConfirmations:     minAcceptedBlockCount,
+	MinDistinctReporters: minAcceptedBlockCount,
+}
+
+// scheduledParams is a ConsensusParams change that takes effect starting at
+// effectiveHeight.
+type scheduledParams struct {
+	effectiveHeight uint64
+	params          ConsensusParams
+}
+
+// paramsSchedule holds every scheduled ConsensusParams change, sorted ascending
+// by effectiveHeight, plus the mutex guarding it.
+type paramsSchedule struct {
+	mu      sync.RWMutex
+	changes []scheduledParams
+}
+
+// ParamsAt returns the ConsensusParams in effect at height: the most recently
+// scheduled change whose effectiveHeight is at or before height, or
+// defaultConsensusParams if none has taken effect yet.
+func (p *BlockProcessor) ParamsAt(height uint64) ConsensusParams {
+	p.params.mu.RLock()
+	defer p.params.mu.RUnlock()
+
+	params := defaultConsensusParams
+	for _, change := range p.params.changes {
+		if change.effectiveHeight > height {
+			break
+		}
+		params = change.params
+	}
+	return params
+}
+
+// UpdateParams schedules params to take effect starting at fromHeight+1, so an
+// acceptance decision already in flight for fromHeight can't be retroactively
+// invalidated by the very change that altered the rules. It rejects changes
+// scheduled at or before the current max accepted height, since those heights
+// are already decided (or being decided under the current rules).
+func (p *BlockProcessor) UpdateParams(fromHeight uint64, params ConsensusParams) error {
+	maxHeight := atomic.LoadUint64(&p.maxHeight)
+	if fromHeight <= maxHeight {
+		return fmt.Errorf("chain: cannot schedule params change at height %d at or before max accepted height %d", fromHeight, maxHeight)
+	}
+
+	effectiveHeight := fromHeight + 1
+
+	p.params.mu.Lock()
+	defer p.params.mu.Unlock()
+
+	i := sort.Search(len(p.params.changes), func(i int) bool {
+		return p.params.changes[i].effectiveHeight >= effectiveHeight
+	})
+
+	if i < len(p.params.changes) && p.params.changes[i].effectiveHeight == effectiveHeight {
+		p.params.changes[i].params = params
+		return nil
+	}
+
+	p.params.changes = append(p.params.changes, scheduledParams{})
+	copy(p.params.changes[i+1:], p.params.changes[i:])
+	p.params.changes[i] = scheduledParams{effectiveHeight: effectiveHeight, params: params}
+	return nil
+}
@@ -0,0 +1,45 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamsAtDefaultsToMinAcceptedBlockCount(t *testing.T) {
+	processor := NewBlockProcessor()
+
+	params := processor.ParamsAt(1)
+	assert.EqualValues(t, minAcceptedBlockCount, params.MinConfirmations)
+	assert.EqualValues(t, minAcceptedBlockCount, params.MinDistinctReporters)
+}
+
+func TestUpdateParamsRejectsHeightsAtOrBelowMaxHeight(t *testing.T) {
+	processor := NewBlockProcessor()
+	acceptAtHeight(processor, 1, "a")
+
+	err := processor.UpdateParams(1, ConsensusParams{MinConfirmations: 1, MinDistinctReporters: 1})
+	assert.Error(t, err)
+}
+
+func TestUpdateParamsTakesEffectOneHeightAfterScheduled(t *testing.T) {
+	processor := NewBlockProcessor()
+	acceptAtHeight(processor, 1, "a")
+
+	// schedule a looser rule starting at height 2; it should only take effect at
+	// height 3 (scheduled height + 1), not at height 2 itself
+	err := processor.UpdateParams(2, ConsensusParams{MinConfirmations: 1, MinDistinctReporters: 1})
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, minAcceptedBlockCount, processor.ParamsAt(2).MinConfirmations)
+	assert.EqualValues(t, 1, processor.ParamsAt(3).MinConfirmations)
+
+	// height 2 still needs the old threshold: one confirmation isn't enough
+	height := processor.ProcessBlocks(2, []string{"b"})
+	assert.EqualValues(t, 1, height)
+
+	// finish accepting height 2 under the old rule, then height 3 needs just one
+	acceptAtHeight(processor, 2, "b")
+	height = processor.ProcessBlocks(3, []string{"c"})
+	assert.EqualValues(t, 3, height)
+}
@@ -0,0 +1,317 @@
+package chain
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	BlockProcessor.ProcessBlocks accepts anonymous batches of blocks: it has no notion of who
+	reported a block, so a single misbehaving or simply chatty source calling ProcessBlocks three
+	times with the same block ID can confirm a height on its own. BlockPool closes that gap by
+	requiring votes from *distinct* peers - ConsensusParams.MinDistinctReporters worth, per
+	processor.ParamsAt(height) - before a block is ever forwarded to the wrapped BlockProcessor.
+
+	Votes are tracked per (height, blockID) pair as a set of peer IDs, counted independently of the
+	BlockProcessor: repeated reports from the same peer only ever add that peer to the set once, so
+	they can never inflate the vote count. Only once the set reaches the required number of distinct
+	peers is the pair forwarded to the BlockProcessor, and only once - a pair is never forwarded
+	twice, since acceptance can't be undone if a peer is later removed.
+
+	Because a peer's pending votes need to be found and removed when that peer disconnects or is
+	blacklisted, a reverse index from peerID to the vote keys it contributed to is kept alongside
+	the votes themselves, so RemovePeer only has to touch that peer's own entries instead of
+	scanning every pending height.
+
+	ProcessBlocks forwards confirmed votes through BlockProcessor's legacy string API, which has no
+	notion of parent linkage; ProcessHeaders forwards through BlockProcessor.ProcessHeaders instead,
+	so peer-aware vote counting composes with fork rejection rather than bypassing it.
+*/
+
+// requestChannelBufferSize is how many requests or timeout notifications are
+// held while nothing is draining the channel; RequestMissing and NotifyTimeout
+// never block, and drop whatever doesn't fit once the buffer is full.
+const requestChannelBufferSize = 64
+
+// BlockRequest describes a height above the processor's max accepted height,
+// up to the highest height any peer has reported, whether or not any peer has
+// voted for that height yet; used to drive fetching of missing blocks from peers.
+type BlockRequest struct {
+	Height uint64
+}
+
+// voteKey identifies a single (height, blockID) pair.
+type voteKey struct {
+	height  uint64
+	blockID string
+}
+
+// peerVotes tracks which peers have voted for a single voteKey, and whether
+// that vote set has already been forwarded to the underlying BlockProcessor.
+type peerVotes struct {
+	mu        sync.Mutex
+	peers     map[string]struct{}
+	forwarded bool
+}
+
+// BlockPool wraps a BlockProcessor with peer-aware accounting: only once
+// ConsensusParams.MinDistinctReporters distinct peers report the same
+// (height, blockID) pair is it forwarded to the underlying processor for
+// acceptance.
+type BlockPool struct {
+	processor *BlockProcessor
+
+	// votes maps voteKey -> *peerVotes
+	votes sync.Map
+
+	// highest height any peer has reported a block for, used to know how far
+	// ahead of the processor's maxHeight we should be requesting blocks
+	highestReported uint64
+
+	// peerIndex maps peerID -> set of voteKeys that peer has voted for, so a
+	// peer's contributions can be removed without scanning all pending votes
+	peerIndexMu sync.Mutex
+	peerIndex   map[string]map[voteKey]struct{}
+
+	badPeersMu sync.Mutex
+	badPeers   map[string]error
+
+	// RequestsCh carries heights the caller should fetch from peers
+	RequestsCh chan BlockRequest
+	// TimeoutsCh carries peer IDs that failed to respond to a request in time
+	TimeoutsCh chan string
+}
+
+// NewBlockPool creates a BlockPool that forwards accepted votes to processor.
+func NewBlockPool(processor *BlockProcessor) *BlockPool {
+	return &BlockPool{
+		processor:  processor,
+		peerIndex:  make(map[string]map[voteKey]struct{}),
+		badPeers:   make(map[string]error),
+		RequestsCh: make(chan BlockRequest, requestChannelBufferSize),
+		TimeoutsCh: make(chan string, requestChannelBufferSize),
+	}
+}
+
+// ProcessBlocks records peerID's vote for a sequence of blocks starting at
+// startHeight and forwards newly-confirmed votes to the wrapped BlockProcessor.
+// It returns the processor's current max accepted height, or an error if
+// peerID has been blacklisted via MarkPeerBad.
+//
+// This is the legacy string-only entry point: like BlockProcessor.ProcessBlocks,
+// it carries no parent linkage, so nothing here stops a confirmed block at
+// height H from being followed by a confirmed but unrelated block at H+1.
+// Callers that need fork protection should use ProcessHeaders instead.
+func (bp *BlockPool) ProcessBlocks(peerID string, startHeight uint64, blocks []string) (uint64, error) {
+	if bp.isBadPeer(peerID) {
+		return atomic.LoadUint64(&bp.processor.maxHeight), fmt.Errorf("chain: peer %s is blacklisted", peerID)
+	}
+
+	height := startHeight
+	for _, block := range blocks {
+		bp.observeHeight(height)
+
+		if block != "" && bp.recordVote(peerID, height, block) {
+			// the pool has already confirmed enough distinct peers reported this
+			// block for height; forward it MinConfirmations times so the
+			// BlockProcessor's own per-height counter reaches its threshold too
+			confirmations := int(bp.processor.ParamsAt(height).MinConfirmations)
+			for i := 0; i < confirmations; i++ {
+				bp.processor.ProcessBlocks(height, []string{block})
+			}
+		}
+
+		height++
+	}
+
+	return atomic.LoadUint64(&bp.processor.maxHeight), nil
+}
+
+// ProcessHeaders records peerID's vote for a sequence of headers and forwards
+// newly-confirmed votes to the wrapped BlockProcessor via ProcessHeaders, so
+// the pool's peer-aware vote counting composes with parent-linkage checking
+// instead of bypassing it through the legacy string path. It returns the
+// processor's current max accepted height, or an error if peerID has been
+// blacklisted via MarkPeerBad or a confirmed header is rejected for describing
+// a fork.
+func (bp *BlockPool) ProcessHeaders(peerID string, headers []Header) (uint64, error) {
+	if bp.isBadPeer(peerID) {
+		return atomic.LoadUint64(&bp.processor.maxHeight), fmt.Errorf("chain: peer %s is blacklisted", peerID)
+	}
+
+	for _, h := range headers {
+		bp.observeHeight(h.Height)
+
+		if h.ID != "" && bp.recordVote(peerID, h.Height, h.ID) {
+			// same rationale as ProcessBlocks: forward MinConfirmations times so
+			// the BlockProcessor's own per-height counter reaches its threshold
+			confirmations := int(bp.processor.ParamsAt(h.Height).MinConfirmations)
+			for i := 0; i < confirmations; i++ {
+				if _, err := bp.processor.ProcessHeaders([]Header{h}); err != nil {
+					return atomic.LoadUint64(&bp.processor.maxHeight), err
+				}
+			}
+		}
+	}
+
+	return atomic.LoadUint64(&bp.processor.maxHeight), nil
+}
+
+// recordVote registers peerID's vote for (height, blockID) and reports whether
+// this vote is what first brought the pair to the MinDistinctReporters
+// ConsensusParams requires for height, meaning it should now be forwarded to
+// the BlockProcessor.
+func (bp *BlockPool) recordVote(peerID string, height uint64, blockID string) bool {
+	key := voteKey{height: height, blockID: blockID}
+
+	v := &peerVotes{peers: make(map[string]struct{})}
+	if loaded, ok := bp.votes.LoadOrStore(key, v); ok {
+		v = loaded.(*peerVotes)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, voted := v.peers[peerID]; !voted {
+		v.peers[peerID] = struct{}{}
+		bp.indexVote(peerID, key)
+	}
+
+	threshold := int(bp.processor.ParamsAt(height).MinDistinctReporters)
+	if v.forwarded || len(v.peers) < threshold {
+		return false
+	}
+
+	v.forwarded = true
+	return true
+}
+
+func (bp *BlockPool) indexVote(peerID string, key voteKey) {
+	bp.peerIndexMu.Lock()
+	defer bp.peerIndexMu.Unlock()
+
+	keys, ok := bp.peerIndex[peerID]
+	if !ok {
+		keys = make(map[voteKey]struct{})
+		bp.peerIndex[peerID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func (bp *BlockPool) observeHeight(height uint64) {
+	for {
+		cur := atomic.LoadUint64(&bp.highestReported)
+		if height <= cur {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&bp.highestReported, cur, height) {
+			return
+		}
+	}
+}
+
+// RemovePeer discards peerID's contribution to every pending (height, blockID)
+// pair it has voted for. Heights already accepted by the underlying processor
+// are unaffected: acceptance cannot be undone, only prevented going forward.
+func (bp *BlockPool) RemovePeer(peerID string) {
+	bp.peerIndexMu.Lock()
+	keys := bp.peerIndex[peerID]
+	delete(bp.peerIndex, peerID)
+	bp.peerIndexMu.Unlock()
+
+	for key := range keys {
+		if v, ok := bp.votes.Load(key); ok {
+			votes := v.(*peerVotes)
+			votes.mu.Lock()
+			delete(votes.peers, peerID)
+			votes.mu.Unlock()
+		}
+	}
+}
+
+// MarkPeerBad removes peerID's pending votes the same way RemovePeer does and
+// additionally blacklists peerID, so future ProcessBlocks and ProcessHeaders
+// calls on its behalf are rejected with an error naming the peer. reason is
+// stored with the blacklist entry but is not included in that error.
+func (bp *BlockPool) MarkPeerBad(peerID string, reason error) {
+	bp.RemovePeer(peerID)
+
+	bp.badPeersMu.Lock()
+	bp.badPeers[peerID] = reason
+	bp.badPeersMu.Unlock()
+}
+
+func (bp *BlockPool) isBadPeer(peerID string) bool {
+	bp.badPeersMu.Lock()
+	defer bp.badPeersMu.Unlock()
+
+	_, bad := bp.badPeers[peerID]
+	return bad
+}
+
+// RequestMissing enqueues a BlockRequest on RequestsCh for every height from
+// the processor's max accepted height + 1 up to the highest height any peer has
+// reported a block for. It's meant to be called periodically by whatever drives block fetching.
+// If RequestsCh isn't being drained, pending heights are simply skipped rather
+// than blocking the caller.
+func (bp *BlockPool) RequestMissing() {
+	maxHeight := atomic.LoadUint64(&bp.processor.maxHeight)
+	highest := atomic.LoadUint64(&bp.highestReported)
+
+	for h := maxHeight + 1; h <= highest; h++ {
+		select {
+		case bp.RequestsCh <- BlockRequest{Height: h}:
+		default:
+		}
+	}
+}
+
+// NotifyTimeout reports that peerID failed to respond to a block request in
+// time, so whatever is draining TimeoutsCh can decide to RemovePeer or
+// MarkPeerBad it.
+func (bp *BlockPool) NotifyTimeout(peerID string) {
+	select {
+	case bp.TimeoutsCh <- peerID:
+	default:
+	}
+}
+
+// Prune discards vote bookkeeping for every height below the wrapped
+// processor's current Base(), the same way BlockProcessor.PruneBlocks reclaims
+// blockTracker: without this, votes and peerIndex would grow for the lifetime
+// of the process even as the underlying processor prunes its own history.
+// Callers should call Prune alongside PruneBlocks, e.g. right after it.
+func (bp *BlockPool) Prune() {
+	base := bp.processor.Base()
+
+	bp.votes.Range(func(k, v interface{}) bool {
+		key := k.(voteKey)
+		if key.height >= base {
+			return true
+		}
+
+		votes := v.(*peerVotes)
+		votes.mu.Lock()
+		peers := make([]string, 0, len(votes.peers))
+		for peerID := range votes.peers {
+			peers = append(peers, peerID)
+		}
+		votes.mu.Unlock()
+
+		bp.votes.Delete(key)
+
+		bp.peerIndexMu.Lock()
+		for _, peerID := range peers {
+			if keys, ok := bp.peerIndex[peerID]; ok {
+				delete(keys, key)
+				if len(keys) == 0 {
+					delete(bp.peerIndex, peerID)
+				}
+			}
+		}
+		bp.peerIndexMu.Unlock()
+
+		return true
+	})
+}
@@ -0,0 +1,160 @@
+package chain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockPoolSamePeerRepeatingDoesNotAcceptBlock(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+
+	pool.ProcessBlocks("peer-1", 1, []string{"a"})
+	pool.ProcessBlocks("peer-1", 1, []string{"a"})
+	height, err := pool.ProcessBlocks("peer-1", 1, []string{"a"})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, height)
+}
+
+func TestBlockPoolDistinctPeersAcceptBlock(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+
+	pool.ProcessBlocks("peer-1", 1, []string{"a"})
+	pool.ProcessBlocks("peer-2", 1, []string{"a"})
+	height, err := pool.ProcessBlocks("peer-3", 1, []string{"a"})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, height)
+}
+
+func TestBlockPoolRemovePeerDropsPendingVotes(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+
+	pool.ProcessBlocks("peer-1", 1, []string{"a"})
+	pool.ProcessBlocks("peer-2", 1, []string{"a"})
+	pool.RemovePeer("peer-2")
+
+	// peer-2's vote was removed, so a third distinct peer is still needed
+	height, err := pool.ProcessBlocks("peer-3", 1, []string{"a"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, height)
+
+	height, err = pool.ProcessBlocks("peer-2", 1, []string{"a"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, height)
+}
+
+func TestBlockPoolMarkPeerBadBlacklistsFutureSubmissions(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+
+	pool.MarkPeerBad("peer-1", errors.New("sent conflicting blocks"))
+	height, err := pool.ProcessBlocks("peer-1", 1, []string{"a"})
+
+	assert.Error(t, err)
+	assert.EqualValues(t, 0, height)
+}
+
+func TestBlockPoolRequestMissingEnqueuesGapHeights(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+
+	pool.ProcessBlocks("peer-1", 3, []string{"c"})
+	pool.RequestMissing()
+
+	select {
+	case req := <-pool.RequestsCh:
+		assert.EqualValues(t, 1, req.Height)
+	default:
+		t.Fatal("expected a pending BlockRequest")
+	}
+}
+
+func TestBlockPoolNotifyTimeoutForwardsPeerID(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+
+	pool.NotifyTimeout("peer-1")
+
+	select {
+	case peerID := <-pool.TimeoutsCh:
+		assert.Equal(t, "peer-1", peerID)
+	default:
+		t.Fatal("expected a pending timeout notification")
+	}
+}
+
+func TestBlockPoolProcessHeadersAcceptsHeaderExtendingGenesis(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+	header := Header{Height: 1, ID: "a", ParentID: GenesisID}
+
+	pool.ProcessHeaders("peer-1", []Header{header})
+	pool.ProcessHeaders("peer-2", []Header{header})
+	height, err := pool.ProcessHeaders("peer-3", []Header{header})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, height)
+}
+
+func TestBlockPoolProcessHeadersRejectsParentMismatch(t *testing.T) {
+	pool := NewBlockPool(NewBlockProcessor())
+	header := Header{Height: 1, ID: "a", ParentID: "not-genesis"}
+
+	pool.ProcessHeaders("peer-1", []Header{header})
+	pool.ProcessHeaders("peer-2", []Header{header})
+	height, err := pool.ProcessHeaders("peer-3", []Header{header})
+
+	assert.ErrorIs(t, err, ErrParentMismatch)
+	assert.EqualValues(t, 0, height)
+}
+
+func TestBlockPoolUpdateParamsTakesEffectOneHeightAfterScheduled(t *testing.T) {
+	processor := NewBlockProcessor()
+	pool := NewBlockPool(processor)
+
+	pool.ProcessBlocks("peer-1", 1, []string{"a"})
+	pool.ProcessBlocks("peer-2", 1, []string{"a"})
+	pool.ProcessBlocks("peer-3", 1, []string{"a"})
+
+	// schedule a looser rule starting at height 2; it should only take effect at
+	// height 3 (scheduled height + 1), not at height 2 itself
+	err := processor.UpdateParams(2, ConsensusParams{MinConfirmations: 1, MinDistinctReporters: 1})
+	assert.NoError(t, err)
+
+	// height 2 still needs the old threshold: a single distinct peer isn't enough
+	height, err := pool.ProcessBlocks("peer-1", 2, []string{"b"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, height)
+
+	// finish accepting height 2 under the old rule, then height 3 needs just one
+	// distinct peer
+	pool.ProcessBlocks("peer-2", 2, []string{"b"})
+	pool.ProcessBlocks("peer-3", 2, []string{"b"})
+
+	height, err = pool.ProcessBlocks("peer-1", 3, []string{"c"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, height)
+}
+
+func TestBlockPoolPruneDropsVotesBelowProcessorBase(t *testing.T) {
+	processor := NewBlockProcessor()
+	pool := NewBlockPool(processor)
+
+	// height 1 gets a single, never-confirmed vote; it should be forgotten once
+	// the processor's base moves past it
+	pool.ProcessBlocks("peer-1", 1, []string{"stale"})
+
+	acceptAtHeight(processor, 1, "a")
+	acceptAtHeight(processor, 2, "b")
+	_, err := processor.PruneBlocks(2)
+	assert.NoError(t, err)
+
+	pool.Prune()
+
+	_, ok := pool.votes.Load(voteKey{height: 1, blockID: "stale"})
+	assert.False(t, ok, "votes for a pruned height should have been forgotten")
+
+	pool.peerIndexMu.Lock()
+	_, ok = pool.peerIndex["peer-1"]
+	pool.peerIndexMu.Unlock()
+	assert.False(t, ok, "peer-1's only vote was for a pruned height, so it should have no remaining index entries")
+}
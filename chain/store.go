@@ -0,0 +1,279 @@
+package chain
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Record is a single accepted (height, blockID) pair, as durably persisted by
+// a Store.
+type Record struct {
+	Height  uint64
+	BlockID string
+}
+
+// Store persists accepted heights so a restarted BlockProcessor can recover
+// maxHeight, base, and the accepted block ID at each height, instead of always
+// starting from genesis.
+type Store interface {
+	// Append durably records that blockID was accepted at height. Callers
+	// always append heights in strictly increasing order, one at a time.
+	Append(height uint64, blockID string) error
+
+	// Load returns every previously appended Record, ordered by height.
+	Load() ([]Record, error)
+
+	// PruneBelow discards persisted records for heights below height and
+	// durably records height as the new prune floor, retrievable via LoadBase.
+	PruneBelow(height uint64) error
+
+	// LoadBase returns the prune floor most recently recorded by PruneBelow, or
+	// 0 if PruneBelow has never been called. Recovery must use this rather than
+	// inferring base from the lowest persisted record: a record can also be
+	// missing because Append failed transiently, which is indistinguishable
+	// from a legitimate prune if base were inferred from Load alone.
+	LoadBase() (uint64, error)
+}
+
+// MemoryStore is an in-memory Store, useful for tests and callers that don't
+// need acceptance to survive a restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records []Record
+	base    uint64
+}
+
+// NewMemoryStore creates an empty in-memory Store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append implements Store.
+func (s *MemoryStore) Append(height uint64, blockID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, Record{Height: height, BlockID: blockID})
+	return nil
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Record, len(s.records))
+	copy(out, s.records)
+	return out, nil
+}
+
+// PruneBelow implements Store.
+func (s *MemoryStore) PruneBelow(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.records[:0]
+	for _, r := range s.records {
+		if r.Height >= height {
+			kept = append(kept, r)
+		}
+	}
+	s.records = kept
+	s.base = height
+	return nil
+}
+
+// LoadBase implements Store.
+func (s *MemoryStore) LoadBase() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.base, nil
+}
+
+// recordHeaderSize is the fixed-size prefix written before every record's
+// blockID: an 8-byte height followed by a 4-byte blockID length.
+const recordHeaderSize = 8 + 4
+
+// FileStore is a Store backed by an append-only file of length-prefixed
+// records, so Append doesn't need to rewrite earlier records. The prune floor
+// PruneBelow records is kept in a separate fixed-size sidecar file, since it
+// must survive independently of whatever records happen to still be present.
+type FileStore struct {
+	mu       sync.Mutex
+	file     *os.File
+	baseFile *os.File
+}
+
+// baseFileSuffix names the sidecar file that stores the prune floor alongside
+// the main WAL file at path.
+const baseFileSuffix = ".base"
+
+// NewFileStore opens (creating if necessary) the WAL file at path, along with
+// its prune-floor sidecar file.
+func NewFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("chain: opening wal file: %w", err)
+	}
+
+	baseFile, err := os.OpenFile(path+baseFileSuffix, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("chain: opening wal base file: %w", err)
+	}
+
+	return &FileStore{file: file, baseFile: baseFile}, nil
+}
+
+// Append implements Store.
+func (s *FileStore) Append(height uint64, blockID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(encodeRecord(Record{Height: height, BlockID: blockID})); err != nil {
+		return fmt.Errorf("chain: appending wal record: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("chain: syncing wal file: %w", err)
+	}
+	return nil
+}
+
+// Load implements Store.
+func (s *FileStore) Load() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.loadLocked()
+}
+
+// PruneBelow implements Store.
+func (s *FileStore) PruneBelow(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+
+	kept := records[:0]
+	for _, r := range records {
+		if r.Height >= height {
+			kept = append(kept, r)
+		}
+	}
+
+	if err := s.rewriteLocked(kept); err != nil {
+		return err
+	}
+
+	return s.writeBaseLocked(height)
+}
+
+// LoadBase implements Store.
+func (s *FileStore) LoadBase() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.baseFile.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("chain: seeking wal base file: %w", err)
+	}
+
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(s.baseFile, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("chain: reading wal base file: %w", err)
+	}
+
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (s *FileStore) writeBaseLocked(height uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, height)
+
+	if err := s.baseFile.Truncate(0); err != nil {
+		return fmt.Errorf("chain: truncating wal base file: %w", err)
+	}
+	if _, err := s.baseFile.WriteAt(buf, 0); err != nil {
+		return fmt.Errorf("chain: writing wal base file: %w", err)
+	}
+
+	return s.baseFile.Sync()
+}
+
+// Close releases the underlying file handles.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return s.baseFile.Close()
+}
+
+func (s *FileStore) loadLocked() ([]Record, error) {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("chain: seeking wal file: %w", err)
+	}
+	defer s.file.Seek(0, io.SeekEnd)
+
+	var records []Record
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(s.file, header); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("chain: reading wal record header: %w", err)
+		}
+
+		height := binary.BigEndian.Uint64(header[0:8])
+		idLen := binary.BigEndian.Uint32(header[8:12])
+
+		idBytes := make([]byte, idLen)
+		if _, err := io.ReadFull(s.file, idBytes); err != nil {
+			return nil, fmt.Errorf("chain: reading wal record body: %w", err)
+		}
+
+		records = append(records, Record{Height: height, BlockID: string(idBytes)})
+	}
+
+	return records, nil
+}
+
+func (s *FileStore) rewriteLocked(records []Record) error {
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("chain: truncating wal file: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("chain: seeking wal file: %w", err)
+	}
+
+	for _, r := range records {
+		if _, err := s.file.Write(encodeRecord(r)); err != nil {
+			return fmt.Errorf("chain: rewriting wal record: %w", err)
+		}
+	}
+
+	if _, err := s.file.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("chain: seeking wal file: %w", err)
+	}
+
+	return s.file.Sync()
+}
+
+func encodeRecord(r Record) []byte {
+	buf := make([]byte, recordHeaderSize+len(r.BlockID))
+	binary.BigEndian.PutUint64(buf[0:8], r.Height)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(r.BlockID)))
+	copy(buf[recordHeaderSize:], r.BlockID)
+	return buf
+}
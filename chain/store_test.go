@@ -0,0 +1,116 @@
+package chain
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreAppendAndLoad(t *testing.T) {
+	store := NewMemoryStore()
+
+	assert.NoError(t, store.Append(1, "a"))
+	assert.NoError(t, store.Append(2, "b"))
+
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 1, BlockID: "a"}, {Height: 2, BlockID: "b"}}, records)
+}
+
+func TestMemoryStorePruneBelow(t *testing.T) {
+	store := NewMemoryStore()
+	store.Append(1, "a")
+	store.Append(2, "b")
+	store.Append(3, "c")
+
+	assert.NoError(t, store.PruneBelow(2))
+
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 2, BlockID: "b"}, {Height: 3, BlockID: "c"}}, records)
+}
+
+func TestMemoryStoreLoadBaseReflectsMostRecentPruneBelow(t *testing.T) {
+	store := NewMemoryStore()
+
+	base, err := store.LoadBase()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, base, "no PruneBelow has run yet")
+
+	store.Append(1, "a")
+	store.Append(2, "b")
+	assert.NoError(t, store.PruneBelow(2))
+
+	base, err = store.LoadBase()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, base)
+}
+
+func TestFileStoreAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	store, err := NewFileStore(path)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, store.Append(1, "a"))
+	assert.NoError(t, store.Append(2, "b"))
+
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 1, BlockID: "a"}, {Height: 2, BlockID: "b"}}, records)
+}
+
+func TestFileStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	store, err := NewFileStore(path)
+	assert.NoError(t, err)
+	store.Append(1, "a")
+	store.Append(2, "b")
+	assert.NoError(t, store.Close())
+
+	reopened, err := NewFileStore(path)
+	assert.NoError(t, err)
+	defer reopened.Close()
+
+	records, err := reopened.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 1, BlockID: "a"}, {Height: 2, BlockID: "b"}}, records)
+}
+
+func TestFileStorePruneBelowRewritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	store, err := NewFileStore(path)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	store.Append(1, "a")
+	store.Append(2, "b")
+	store.Append(3, "c")
+
+	assert.NoError(t, store.PruneBelow(3))
+
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 3, BlockID: "c"}}, records)
+}
+
+func TestFileStoreLoadBasePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	store, err := NewFileStore(path)
+	assert.NoError(t, err)
+
+	store.Append(1, "a")
+	store.Append(2, "b")
+	store.Append(3, "c")
+	assert.NoError(t, store.PruneBelow(3))
+	assert.NoError(t, store.Close())
+
+	reopened, err := NewFileStore(path)
+	assert.NoError(t, err)
+	defer reopened.Close()
+
+	base, err := reopened.LoadBase()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, base)
+}
@@ -0,0 +1,148 @@
+package chain
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	Fsyncing inside every processBlock call would serialize the hot acceptance path behind disk
+	I/O, so instead a single goroutine owns the Store and drains walCh, an internal channel of
+	acceptedRecord written to whenever updateMaxHeight succeeds. A single serialized writer both
+	avoids per-persist goroutine churn and preserves append ordering, which a pool of writers
+	racing each other would not.
+
+	PruneBlocks needs that same ordering guarantee: calling store.PruneBelow directly from
+	PruneBlocks would race the writer, since an acceptedRecord already sent to walCh may still be
+	sitting in its buffer, unappended, at the moment PruneBelow runs - the writer would then
+	"resurrect" a record PruneBelow believed it had already discarded. So a prune is sent down
+	walCh as a pruneCommand instead, and the single writer applies it in the exact order it was
+	received relative to every acceptedRecord already queued ahead of it.
+*/
+
+// walChannelBufferSize bounds how far the writer goroutine can lag behind
+// acceptance before updateMaxHeight starts blocking on a send.
+const walChannelBufferSize = 256
+
+// acceptedRecord is sent on walCh whenever updateMaxHeight accepts a new height.
+type acceptedRecord struct {
+	height  uint64
+	blockID string
+}
+
+// pruneCommand is sent on walCh whenever PruneBlocks needs store records
+// discarded, reporting the result of store.PruneBelow on done once the writer
+// has processed every acceptedRecord queued ahead of it.
+type pruneCommand struct {
+	retainHeight uint64
+	done         chan error
+}
+
+// walEntry is sent on walCh; exactly one of accept or prune is set.
+type walEntry struct {
+	accept *acceptedRecord
+	prune  *pruneCommand
+}
+
+// NewBlockProcessorWithStore creates a BlockProcessor that persists every
+// acceptance to store via a single background writer goroutine, replaying
+// store's contents first so maxHeight, base and the accepted block ID at each
+// height survive a restart.
+func NewBlockProcessorWithStore(store Store) (*BlockProcessor, error) {
+	records, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("chain: loading wal: %w", err)
+	}
+
+	base, err := store.LoadBase()
+	if err != nil {
+		return nil, fmt.Errorf("chain: loading wal base: %w", err)
+	}
+
+	p := &BlockProcessor{
+		blockTracker: sync.Map{},
+		store:        store,
+		walCh:        make(chan walEntry, walChannelBufferSize),
+		walDone:      make(chan struct{}),
+	}
+	p.acceptedByHeight.Store(uint64(0), GenesisID)
+
+	var maxHeight uint64
+	for _, r := range records {
+		maxHeight = r.Height
+		p.acceptedByHeight.Store(r.Height, r.BlockID)
+	}
+	// PruneBlocks may have pruned every record, including the last accepted
+	// one; base never passes maxHeight+1, so maxHeight is at least base-1
+	if base > 0 && maxHeight < base-1 {
+		maxHeight = base - 1
+	}
+	atomic.StoreUint64(&p.maxHeight, maxHeight)
+	atomic.StoreUint64(&p.base, base)
+
+	go p.runWAL(maxHeight)
+
+	return p, nil
+}
+
+// runWAL drains walCh and processes each entry in order: an acceptedRecord is
+// appended to p.store, flagging (via setWALErr) any record whose height isn't
+// exactly one more than the previous record it saw - that should never happen
+// given updateMaxHeight's own invariants, but the writer doesn't trust that
+// blindly. A pruneCommand is applied via store.PruneBelow, with the result
+// reported back on its done channel.
+//
+// expected is resynced off rec.height after every acceptedRecord, success or
+// failure, so a single out-of-order record or a transient store.Append error
+// never stops the writer from persisting every height that comes after it -
+// only the record that failed is lost, not the rest of the chain.
+func (p *BlockProcessor) runWAL(startHeight uint64) {
+	defer close(p.walDone)
+
+	expected := startHeight + 1
+	for entry := range p.walCh {
+		switch {
+		case entry.accept != nil:
+			rec := entry.accept
+			if rec.height != expected {
+				p.setWALErr(fmt.Errorf("chain: wal append out of order: expected height %d, got %d", expected, rec.height))
+			} else if err := p.store.Append(rec.height, rec.blockID); err != nil {
+				p.setWALErr(fmt.Errorf("chain: wal append failed at height %d: %w", rec.height, err))
+			}
+
+			expected = rec.height + 1
+
+		case entry.prune != nil:
+			entry.prune.done <- p.store.PruneBelow(entry.prune.retainHeight)
+		}
+	}
+}
+
+func (p *BlockProcessor) setWALErr(err error) {
+	p.walMu.Lock()
+	if p.walErr == nil {
+		p.walErr = err
+	}
+	p.walMu.Unlock()
+}
+
+// Close stops any background goroutine owned by the processor - the WAL
+// writer started by NewBlockProcessorWithStore and the pruning loop started by
+// NewBlockProcessorWithOptions - and returns the first write error, if any,
+// observed by the WAL writer goroutine. It is safe to call more than once.
+func (p *BlockProcessor) Close() error {
+	p.closeOnce.Do(func() {
+		if p.stopCh != nil {
+			close(p.stopCh)
+		}
+		if p.walCh != nil {
+			close(p.walCh)
+			<-p.walDone
+		}
+	})
+
+	p.walMu.Lock()
+	defer p.walMu.Unlock()
+	return p.walErr
+}
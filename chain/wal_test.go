@@ -0,0 +1,162 @@
+package chain
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore is a Store whose Append always fails, used to exercise the WAL
+// writer's error reporting.
+type failingStore struct {
+	MemoryStore
+}
+
+func (s *failingStore) Append(height uint64, blockID string) error {
+	return errors.New("disk is full")
+}
+
+// flakyStore fails Append exactly once, then behaves like MemoryStore, used to
+// verify a single transient failure doesn't permanently stop the WAL writer
+// from persisting later heights.
+type flakyStore struct {
+	MemoryStore
+
+	mu     sync.Mutex
+	failed bool
+}
+
+func (s *flakyStore) Append(height uint64, blockID string) error {
+	s.mu.Lock()
+	if !s.failed {
+		s.failed = true
+		s.mu.Unlock()
+		return errors.New("transient disk hiccup")
+	}
+	s.mu.Unlock()
+
+	return s.MemoryStore.Append(height, blockID)
+}
+
+func TestNewBlockProcessorWithStoreReplaysRecords(t *testing.T) {
+	store := NewMemoryStore()
+	store.Append(1, "a")
+	store.Append(2, "b")
+
+	processor, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+	defer processor.Close()
+
+	assert.EqualValues(t, 2, processor.ProcessBlocks(3, []string{}))
+	// store.PruneBelow was never called on this store, so base recovers as 0
+	// rather than being inferred from the lowest persisted record
+	assert.EqualValues(t, 0, processor.Base())
+}
+
+func TestNewBlockProcessorWithStorePersistsAcceptedHeights(t *testing.T) {
+	store := NewMemoryStore()
+	processor, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+
+	acceptAtHeight(processor, 1, "a")
+	assert.NoError(t, processor.Close())
+
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 1, BlockID: "a"}}, records)
+}
+
+func TestBlockProcessorCloseReturnsWriterError(t *testing.T) {
+	processor, err := NewBlockProcessorWithStore(&failingStore{})
+	assert.NoError(t, err)
+
+	acceptAtHeight(processor, 1, "a")
+
+	// Close joins the writer goroutine, so it observes every record appended
+	// before it returned, including the failing one
+	assert.Error(t, processor.Close())
+}
+
+func TestNewBlockProcessorWithStoreSurvivesATransientAppendFailure(t *testing.T) {
+	store := &flakyStore{}
+	processor, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+
+	acceptAtHeight(processor, 1, "a") // fails to persist, store.Append's one failure
+	acceptAtHeight(processor, 2, "b")
+	acceptAtHeight(processor, 3, "c")
+
+	assert.Error(t, processor.Close())
+
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 2, BlockID: "b"}, {Height: 3, BlockID: "c"}}, records)
+}
+
+func TestPruneBlocksPrunesTheUnderlyingStore(t *testing.T) {
+	store := NewMemoryStore()
+	processor, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+
+	acceptAtHeight(processor, 1, "a")
+	acceptAtHeight(processor, 2, "b")
+
+	// prune while the processor is still live: PruneBelow is routed through the
+	// same WAL writer goroutine that appends, so this can't race an
+	// acceptedRecord that's still sitting in walCh's buffer, unwritten
+	_, err = processor.PruneBlocks(2)
+	assert.NoError(t, err)
+
+	records, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{Height: 2, BlockID: "b"}}, records)
+
+	assert.NoError(t, processor.Close())
+}
+
+func TestNewBlockProcessorWithStoreRecoversBaseFromALegitimatePrune(t *testing.T) {
+	store := NewMemoryStore()
+	processor, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+
+	acceptAtHeight(processor, 1, "a")
+	acceptAtHeight(processor, 2, "b")
+	_, err = processor.PruneBlocks(2)
+	assert.NoError(t, err)
+	assert.NoError(t, processor.Close())
+
+	restarted, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+	defer restarted.Close()
+
+	assert.EqualValues(t, 2, restarted.Base())
+}
+
+func TestNewBlockProcessorWithStoreDoesNotInferBaseFromALostAppend(t *testing.T) {
+	store := &flakyStore{}
+	processor, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+
+	acceptAtHeight(processor, 1, "a") // lost to store.Append's one transient failure
+	acceptAtHeight(processor, 2, "b")
+	assert.Error(t, processor.Close())
+
+	// height 1 is missing from the store, but PruneBelow was never called, so
+	// the recovered base must stay 0 rather than jumping to 2 as if height 1
+	// had been legitimately pruned
+	restarted, err := NewBlockProcessorWithStore(store)
+	assert.NoError(t, err)
+	defer restarted.Close()
+
+	assert.EqualValues(t, 0, restarted.Base())
+}
+
+func TestBlockProcessorCloseIsIdempotent(t *testing.T) {
+	processor, err := NewBlockProcessorWithStore(NewMemoryStore())
+	assert.NoError(t, err)
+
+	assert.NoError(t, processor.Close())
+	assert.NoError(t, processor.Close())
+}